@@ -0,0 +1,215 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// BreakerConfig tunes the per-target-host circuit breaker: it trips once at
+// least FailureThreshold requests have been observed and the failure ratio
+// reaches FailureRatio, staying open for OpenDuration before allowing a
+// single half-open probe through.
+type BreakerConfig struct {
+	FailureThreshold int      `json:"failure_threshold"`
+	FailureRatio     float64  `json:"failure_ratio"`
+	OpenDuration     Duration `json:"open_duration"`
+}
+
+type breakerState int
+
+const (
+	breakerClosed breakerState = iota
+	breakerOpen
+	breakerHalfOpen
+)
+
+func (s breakerState) String() string {
+	switch s {
+	case breakerOpen:
+		return "open"
+	case breakerHalfOpen:
+		return "half-open"
+	default:
+		return "closed"
+	}
+}
+
+// circuitBreaker is a Sony-gobreaker-style closed/open/half-open breaker
+// for a single upstream target host.
+type circuitBreaker struct {
+	cfg BreakerConfig
+
+	mu               sync.Mutex
+	state            breakerState
+	failures         int
+	successes        int
+	openedAt         time.Time
+	halfOpenInFlight bool
+	lastUsed         time.Time
+}
+
+func newCircuitBreaker(cfg BreakerConfig) *circuitBreaker {
+	return &circuitBreaker{cfg: cfg, lastUsed: time.Now()}
+}
+
+// allow reports whether a request to this target may proceed right now. A
+// single probe request is let through once the breaker has been open for
+// OpenDuration; further requests are rejected until that probe completes.
+func (b *circuitBreaker) allow() bool {
+	if b.cfg.FailureThreshold <= 0 {
+		return true
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.lastUsed = time.Now()
+
+	switch b.state {
+	case breakerOpen:
+		if time.Since(b.openedAt) < b.cfg.OpenDuration.Duration {
+			return false
+		}
+		b.state = breakerHalfOpen
+		b.halfOpenInFlight = true
+		return true
+	case breakerHalfOpen:
+		return false
+	default:
+		return true
+	}
+}
+
+// recordResult reports whether the just-completed request to this target
+// succeeded, updating the breaker's state accordingly.
+func (b *circuitBreaker) recordResult(success bool) {
+	if b.cfg.FailureThreshold <= 0 {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.lastUsed = time.Now()
+
+	if b.state == breakerHalfOpen {
+		b.halfOpenInFlight = false
+		if success {
+			b.resetLocked()
+		} else {
+			b.tripLocked()
+		}
+		return
+	}
+
+	if success {
+		b.successes++
+	} else {
+		b.failures++
+	}
+
+	total := b.successes + b.failures
+	if total < b.cfg.FailureThreshold {
+		return
+	}
+	if float64(b.failures)/float64(total) >= b.cfg.FailureRatio {
+		b.tripLocked()
+	} else {
+		b.successes, b.failures = 0, 0
+	}
+}
+
+func (b *circuitBreaker) tripLocked() {
+	b.state = breakerOpen
+	b.openedAt = time.Now()
+	b.failures, b.successes = 0, 0
+}
+
+func (b *circuitBreaker) resetLocked() {
+	b.state = breakerClosed
+	b.failures, b.successes = 0, 0
+}
+
+func (b *circuitBreaker) currentState() breakerState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state
+}
+
+func (b *circuitBreaker) idleSince() time.Time {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.lastUsed
+}
+
+// breakerRegistry lazily creates one circuitBreaker per upstream target
+// host.
+type breakerRegistry struct {
+	cfg      BreakerConfig
+	mu       sync.Mutex
+	breakers map[string]*circuitBreaker
+}
+
+func newBreakerRegistry(cfg BreakerConfig) *breakerRegistry {
+	return &breakerRegistry{cfg: cfg, breakers: make(map[string]*circuitBreaker)}
+}
+
+func (r *breakerRegistry) get(host string) *circuitBreaker {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	b, ok := r.breakers[host]
+	if !ok {
+		sweepBreakersLocked(r.breakers)
+		b = newCircuitBreaker(r.cfg)
+		r.breakers[host] = b
+	}
+	return b
+}
+
+// sweepBreakersLocked evicts the least-recently-used breakers until breakers
+// has at most maxTrackedKeys/2 entries, mirroring sweepLocked's bound on
+// rateLimiterRegistry: the map key is the attacker-controlled proxy target
+// host, so without a cap it grows one entry per distinct host forever.
+// Callers must hold mu.
+func sweepBreakersLocked(breakers map[string]*circuitBreaker) {
+	if len(breakers) <= maxTrackedKeys {
+		return
+	}
+	type idleKey struct {
+		key  string
+		idle time.Time
+	}
+	idled := make([]idleKey, 0, len(breakers))
+	for k, b := range breakers {
+		idled = append(idled, idleKey{k, b.idleSince()})
+	}
+	sort.Slice(idled, func(i, j int) bool { return idled[i].idle.Before(idled[j].idle) })
+
+	evict := len(breakers) - maxTrackedKeys/2
+	for i := 0; i < evict; i++ {
+		delete(breakers, idled[i].key)
+	}
+}
+
+// snapshot returns the current state of every target host with a breaker,
+// for rendering in /metrics.
+func (r *breakerRegistry) snapshot() map[string]breakerState {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	states := make(map[string]breakerState, len(r.breakers))
+	for host, b := range r.breakers {
+		states[host] = b.currentState()
+	}
+	return states
+}
+
+// appBreakers is the process-wide breaker registry, (re)configured in main
+// from the loaded Config.
+var appBreakers = newBreakerRegistry(BreakerConfig{})
+
+func writeBreakerOpen(w http.ResponseWriter, host string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusServiceUnavailable)
+	fmt.Fprintf(w, `{"error":"circuit_open","target":%q}`, host)
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCircuitBreakerTripsAfterFailureRatio(t *testing.T) {
+	b := newCircuitBreaker(BreakerConfig{FailureThreshold: 4, FailureRatio: 0.5, OpenDuration: Duration{50 * time.Millisecond}})
+
+	for i := 0; i < 2; i++ {
+		if !b.allow() {
+			t.Fatal("expected breaker to stay closed before the threshold is reached")
+		}
+		b.recordResult(true)
+	}
+	for i := 0; i < 2; i++ {
+		if !b.allow() {
+			t.Fatal("expected breaker to allow requests through right up to tripping")
+		}
+		b.recordResult(false)
+	}
+
+	if b.currentState() != breakerOpen {
+		t.Fatalf("expected breaker to trip open after a 50%% failure ratio, got %v", b.currentState())
+	}
+	if b.allow() {
+		t.Error("expected an open breaker to reject requests")
+	}
+}
+
+func TestCircuitBreakerHalfOpenProbeCloses(t *testing.T) {
+	b := newCircuitBreaker(BreakerConfig{FailureThreshold: 2, FailureRatio: 0.5, OpenDuration: Duration{10 * time.Millisecond}})
+
+	b.allow()
+	b.recordResult(false)
+	b.allow()
+	b.recordResult(false)
+	if b.currentState() != breakerOpen {
+		t.Fatal("expected breaker to be open after consecutive failures")
+	}
+
+	time.Sleep(20 * time.Millisecond)
+
+	if !b.allow() {
+		t.Fatal("expected a single half-open probe to be let through once OpenDuration elapses")
+	}
+	if b.allow() {
+		t.Error("expected a second concurrent probe to be rejected while one is in flight")
+	}
+
+	b.recordResult(true)
+	if b.currentState() != breakerClosed {
+		t.Fatalf("expected a successful probe to close the breaker, got %v", b.currentState())
+	}
+}
+
+func TestCircuitBreakerDisabledByDefault(t *testing.T) {
+	b := newCircuitBreaker(BreakerConfig{})
+	for i := 0; i < 100; i++ {
+		if !b.allow() {
+			t.Fatal("expected a breaker with FailureThreshold 0 to never trip")
+		}
+		b.recordResult(false)
+	}
+}
@@ -0,0 +1,405 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// cacheEntry is a single cached upstream response, along with enough
+// freshness metadata (RFC 7234/5861) to decide whether it can still be
+// served, served stale-while-revalidate, or needs a conditional refresh.
+type cacheEntry struct {
+	status   int
+	header   http.Header
+	body     []byte
+	storedAt time.Time
+
+	maxAge               time.Duration
+	staleWhileRevalidate time.Duration
+	staleIfError         time.Duration
+
+	// varyHeaders is only set on a vary-index entry (see varyIndexKey): the
+	// list of header names the real response declared in its Vary header.
+	// Content entries don't need it themselves, since varyKey already bakes
+	// the resolved header values into the lookup key.
+	varyHeaders []string
+}
+
+func (e *cacheEntry) age() time.Duration { return time.Since(e.storedAt) }
+
+func (e *cacheEntry) fresh() bool { return e.age() <= e.maxAge }
+
+func (e *cacheEntry) withinStaleWhileRevalidate() bool {
+	return e.age() <= e.maxAge+e.staleWhileRevalidate
+}
+
+func (e *cacheEntry) withinStaleIfError() bool {
+	return e.age() <= e.maxAge+e.staleIfError
+}
+
+// Cache is the storage interface behind the response cache. inMemoryCache
+// is the only implementation here; an operator wanting shared/multi-process
+// caching can provide a Redis-backed implementation without touching
+// serveCached.
+type Cache interface {
+	Get(key string) (*cacheEntry, bool)
+	Set(key string, entry *cacheEntry)
+	Delete(key string)
+}
+
+// inMemoryCache is a process-local Cache guarded by a single RWMutex. Good
+// enough for a single ghisa instance; operators running several replicas
+// behind a load balancer should plug in a shared Cache implementation.
+type inMemoryCache struct {
+	mu      sync.RWMutex
+	entries map[string]*cacheEntry
+}
+
+func newInMemoryCache() *inMemoryCache {
+	return &inMemoryCache{entries: make(map[string]*cacheEntry)}
+}
+
+func (c *inMemoryCache) Get(key string) (*cacheEntry, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	entry, ok := c.entries[key]
+	return entry, ok
+}
+
+func (c *inMemoryCache) Set(key string, entry *cacheEntry) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries[key] = entry
+}
+
+func (c *inMemoryCache) Delete(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.entries, key)
+}
+
+var (
+	appCache   Cache = newInMemoryCache()
+	fetchGroup       = newSingleflightGroup()
+)
+
+// cacheKey identifies a cacheable request by method and canonicalized
+// target URL (scheme/host lowercased, query parameters sorted). This is the
+// base key: it doesn't yet account for Vary, since the set of headers to
+// vary on isn't known until the first response arrives (see varyKey).
+func cacheKey(method string, target *url.URL) string {
+	values := target.Query()
+	keys := make([]string, 0, len(values))
+	for k := range values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var q strings.Builder
+	for i, k := range keys {
+		if i > 0 {
+			q.WriteByte('&')
+		}
+		sort.Strings(values[k])
+		q.WriteString(k)
+		q.WriteByte('=')
+		q.WriteString(strings.Join(values[k], ","))
+	}
+
+	return strings.ToUpper(method) + " " + strings.ToLower(target.Scheme) + "://" + strings.ToLower(target.Host) + target.Path + "?" + q.String()
+}
+
+// varyIndexKey is where the set of header names a base key's Vary response
+// declared is recorded, so a later request can compute the full variant key
+// (see varyKey) before it has fetched anything itself. It can never collide
+// with a real varyKey, which always contains "=".
+func varyIndexKey(base string) string { return base + "|vary" }
+
+// varyHeadersFor returns the Vary header names previously recorded for
+// base, or nil if base has never been fetched or never varied.
+func varyHeadersFor(base string) []string {
+	idx, ok := appCache.Get(varyIndexKey(base))
+	if !ok {
+		return nil
+	}
+	return idx.varyHeaders
+}
+
+// rememberVaryHeaders records which headers base's responses vary on, so
+// future lookups for the same URL can compute the right variant key
+// up front instead of fetching first.
+func rememberVaryHeaders(base string, headers []string) {
+	if len(headers) == 0 {
+		return
+	}
+	appCache.Set(varyIndexKey(base), &cacheEntry{varyHeaders: headers, storedAt: time.Now(), maxAge: 24 * time.Hour})
+}
+
+// varyKey extends base with the resolved values of varyHeaders, so that
+// distinct Vary variants (e.g. Accept-Encoding: gzip vs identity) each get
+// their own cache slot instead of overwriting one another.
+func varyKey(base string, varyHeaders []string, r *http.Request) string {
+	if len(varyHeaders) == 0 {
+		return base
+	}
+	sorted := append([]string(nil), varyHeaders...)
+	sort.Strings(sorted)
+
+	var k strings.Builder
+	k.WriteString(base)
+	for _, h := range sorted {
+		k.WriteByte('|')
+		k.WriteString(strings.ToLower(h))
+		k.WriteByte('=')
+		k.WriteString(r.Header.Get(h))
+	}
+	return k.String()
+}
+
+// parseCacheControl splits a Cache-Control header into its directives,
+// lowercasing directive names. Directives without a value (e.g. "no-store")
+// map to "".
+func parseCacheControl(header string) map[string]string {
+	directives := make(map[string]string)
+	for _, part := range strings.Split(header, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		name, value, _ := strings.Cut(part, "=")
+		directives[strings.ToLower(strings.TrimSpace(name))] = strings.Trim(strings.TrimSpace(value), `"`)
+	}
+	return directives
+}
+
+// cachePolicy is the freshness lifetime ghisa derived from an upstream
+// response's Cache-Control/Expires headers.
+type cachePolicy struct {
+	maxAge               time.Duration
+	staleWhileRevalidate time.Duration
+	staleIfError         time.Duration
+	noStore              bool
+}
+
+func computeCachePolicy(resp *http.Response) cachePolicy {
+	cc := parseCacheControl(resp.Header.Get("Cache-Control"))
+
+	var policy cachePolicy
+	if _, ok := cc["no-store"]; ok {
+		policy.noStore = true
+		return policy
+	}
+	if _, ok := cc["private"]; ok {
+		// appCache is a single process-wide store shared by every client, with
+		// no per-client dimension unless the upstream explicitly varies on
+		// something like Authorization/Cookie. "private" means the response
+		// is for this one caller only, so treat it like no-store rather than
+		// risk replaying one client's (possibly authenticated) response to
+		// another.
+		policy.noStore = true
+		return policy
+	}
+
+	if v, ok := cc["max-age"]; ok {
+		if secs, err := strconv.Atoi(v); err == nil {
+			policy.maxAge = time.Duration(secs) * time.Second
+		}
+	} else if expires := resp.Header.Get("Expires"); expires != "" {
+		if t, err := http.ParseTime(expires); err == nil {
+			if d := time.Until(t); d > 0 {
+				policy.maxAge = d
+			}
+		}
+	}
+
+	if _, ok := cc["no-cache"]; ok {
+		policy.maxAge = 0
+	}
+
+	if v, ok := cc["stale-while-revalidate"]; ok {
+		if secs, err := strconv.Atoi(v); err == nil {
+			policy.staleWhileRevalidate = time.Duration(secs) * time.Second
+		}
+	}
+	if v, ok := cc["stale-if-error"]; ok {
+		if secs, err := strconv.Atoi(v); err == nil {
+			policy.staleIfError = time.Duration(secs) * time.Second
+		}
+	}
+
+	return policy
+}
+
+func splitVary(vary string) []string {
+	var headers []string
+	for _, h := range strings.Split(vary, ",") {
+		if h = strings.TrimSpace(h); h != "" {
+			headers = append(headers, h)
+		}
+	}
+	return headers
+}
+
+// serveCached answers a GET request out of appCache when possible, and
+// otherwise fetches the upstream response (coalescing concurrent identical
+// fetches via fetchGroup) and caches it per its Cache-Control/Expires/ETag
+// policy. It implements RFC 5861 stale-while-revalidate/stale-if-error on
+// top of that: an entry past max-age but within the SWR window is served
+// immediately while a fresh copy is fetched in the background.
+func serveCached(w http.ResponseWriter, r *http.Request, target *url.URL, sec SecurityConfig, breaker *circuitBreaker) {
+	baseKey := cacheKey(r.Method, target)
+	key := varyKey(baseKey, varyHeadersFor(baseKey), r)
+	entry, hit := appCache.Get(key)
+
+	if hit && entry.fresh() {
+		writeCachedResponse(w, entry, "HIT")
+		return
+	}
+
+	if hit && entry.withinStaleWhileRevalidate() {
+		writeCachedResponse(w, entry, "REVALIDATED")
+		// Only consume a half-open probe (and only call upstream) if the
+		// breaker actually allows it; the client has already gotten its
+		// response from cache, so a breaker that's still open just means the
+		// background refresh is skipped this time around.
+		if breaker.allow() {
+			go func() {
+				ctx, cancel := context.WithTimeout(context.Background(), sec.RequestTimeout.Duration)
+				defer cancel()
+				bgReq := r.Clone(ctx)
+				fetchGroup.Do(key, func() (interface{}, error) {
+					return fetchAndCache(bgReq, target, sec, baseKey, key, entry, breaker)
+				})
+			}()
+		}
+		return
+	}
+
+	if !breaker.allow() {
+		writeBreakerOpen(w, target.Hostname())
+		return
+	}
+
+	result, err, _ := fetchGroup.Do(key, func() (interface{}, error) {
+		return fetchAndCache(r, target, sec, baseKey, key, entry, breaker)
+	})
+	if err != nil {
+		if errors.Is(err, errResponseTooLarge) {
+			http.Error(w, "GHISA: Upstream response exceeds the configured size limit", http.StatusRequestEntityTooLarge)
+			return
+		}
+		if hit && entry.withinStaleIfError() {
+			writeCachedResponse(w, entry, "REVALIDATED")
+			return
+		}
+		http.Error(w, "GHISA: Failed to make request", http.StatusBadGateway)
+		return
+	}
+
+	writeCachedResponse(w, result.(*cacheEntry), "MISS")
+}
+
+// fetchAndCache performs the upstream GET (conditionally, if prior is a
+// cached entry with validators) and stores the result in appCache, keyed by
+// the Vary-resolved variant of baseKey (see varyKey). It records the
+// outcome on breaker itself, since this is the only place in the cache path
+// that actually talks to the upstream.
+func fetchAndCache(r *http.Request, target *url.URL, sec SecurityConfig, baseKey, key string, prior *cacheEntry, breaker *circuitBreaker) (*cacheEntry, error) {
+	req, err := http.NewRequestWithContext(r.Context(), http.MethodGet, target.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header = r.Header.Clone()
+	stripHopByHopHeaders(req.Header)
+
+	if prior != nil {
+		if etag := prior.header.Get("ETag"); etag != "" {
+			req.Header.Set("If-None-Match", etag)
+		}
+		if lastModified := prior.header.Get("Last-Modified"); lastModified != "" {
+			req.Header.Set("If-Modified-Since", lastModified)
+		}
+	}
+
+	client := &http.Client{Transport: &http.Transport{DialContext: safeDialContext(sec)}}
+	resp, err := client.Do(req)
+	if err != nil {
+		breaker.recordResult(false)
+		return nil, err
+	}
+	defer resp.Body.Close()
+	breaker.recordResult(resp.StatusCode < http.StatusInternalServerError)
+
+	if resp.StatusCode == http.StatusNotModified && prior != nil {
+		policy := computeCachePolicy(resp)
+		if policy.noStore {
+			appCache.Delete(key)
+			return prior, nil
+		}
+		prior.storedAt = time.Now()
+		prior.maxAge = policy.maxAge
+		prior.staleWhileRevalidate = policy.staleWhileRevalidate
+		prior.staleIfError = policy.staleIfError
+		appCache.Set(key, prior)
+		return prior, nil
+	}
+
+	limit := sec.MaxResponseBodyBytes
+	if limit <= 0 {
+		limit = 10 << 20
+	}
+	body, err := readWithinLimit(resp.Body, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	policy := computeCachePolicy(resp)
+	entry := &cacheEntry{
+		status:               resp.StatusCode,
+		header:               resp.Header.Clone(),
+		body:                 body,
+		storedAt:             time.Now(),
+		maxAge:               policy.maxAge,
+		staleWhileRevalidate: policy.staleWhileRevalidate,
+		staleIfError:         policy.staleIfError,
+	}
+	// The entry's body is always the complete upstream body (oversized
+	// responses are rejected above, never truncated), so Content-Length must
+	// reflect it exactly rather than whatever the upstream happened to send.
+	entry.header.Set("Content-Length", strconv.Itoa(len(body)))
+
+	storeKey := key
+	if vary := resp.Header.Get("Vary"); vary != "" {
+		varyHeaders := splitVary(vary)
+		rememberVaryHeaders(baseKey, varyHeaders)
+		storeKey = varyKey(baseKey, varyHeaders, r)
+	}
+
+	if resp.StatusCode == http.StatusOK && !policy.noStore {
+		appCache.Set(storeKey, entry)
+	}
+
+	return entry, nil
+}
+
+func writeCachedResponse(w http.ResponseWriter, entry *cacheEntry, cacheStatus string) {
+	for k, values := range entry.header {
+		for _, v := range values {
+			w.Header().Add(k, v)
+		}
+	}
+	w.Header().Set("Age", strconv.Itoa(int(entry.age().Seconds())))
+	w.Header().Set("X-Ghisa-Cache", cacheStatus)
+	if cacheStatus == "REVALIDATED" {
+		w.Header().Set("Warning", `110 ghisa "Response is Stale"`)
+	}
+	w.WriteHeader(entry.status)
+	w.Write(entry.body)
+}
@@ -0,0 +1,211 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestServeCachedMissThenHit(t *testing.T) {
+	appCache = newInMemoryCache()
+	var hits int64
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(&hits, 1)
+		w.Header().Set("Cache-Control", "max-age=60")
+		w.Write([]byte("fresh response"))
+	}))
+	defer backend.Close()
+
+	target, _ := url.Parse(backend.URL)
+	sec := DefaultConfig().Security
+	sec.AllowedHosts = []string{"127.0.0.1"}
+
+	breaker := newCircuitBreaker(BreakerConfig{})
+
+	w1 := httptest.NewRecorder()
+	serveCached(w1, httptest.NewRequest(http.MethodGet, "/", nil), target, sec, breaker)
+	if got := w1.Header().Get("X-Ghisa-Cache"); got != "MISS" {
+		t.Errorf("expected MISS on first request, got %q", got)
+	}
+
+	w2 := httptest.NewRecorder()
+	serveCached(w2, httptest.NewRequest(http.MethodGet, "/", nil), target, sec, breaker)
+	if got := w2.Header().Get("X-Ghisa-Cache"); got != "HIT" {
+		t.Errorf("expected HIT on second request, got %q", got)
+	}
+	if w2.Body.String() != "fresh response" {
+		t.Errorf("expected cached body, got %q", w2.Body.String())
+	}
+
+	if atomic.LoadInt64(&hits) != 1 {
+		t.Errorf("expected exactly one upstream fetch, got %d", hits)
+	}
+}
+
+func TestFetchAndCacheRejectsOversizedResponse(t *testing.T) {
+	appCache = newInMemoryCache()
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("this response body is over the configured limit"))
+	}))
+	defer backend.Close()
+
+	target, _ := url.Parse(backend.URL)
+	sec := DefaultConfig().Security
+	sec.AllowedHosts = []string{"127.0.0.1"}
+	sec.MaxResponseBodyBytes = 10
+	breaker := newCircuitBreaker(BreakerConfig{})
+
+	w := httptest.NewRecorder()
+	serveCached(w, httptest.NewRequest(http.MethodGet, "/", nil), target, sec, breaker)
+
+	if w.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("expected 413 for an oversized upstream response, got %d", w.Code)
+	}
+	if _, hit := appCache.Get(cacheKey(http.MethodGet, target)); hit {
+		t.Error("expected an oversized response not to be cached")
+	}
+}
+
+func TestServeCachedVariesOnDistinctHeaderValues(t *testing.T) {
+	appCache = newInMemoryCache()
+	var hits int64
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(&hits, 1)
+		w.Header().Set("Cache-Control", "max-age=60")
+		w.Header().Set("Vary", "Accept-Encoding")
+		w.Write([]byte("encoded as " + r.Header.Get("Accept-Encoding")))
+	}))
+	defer backend.Close()
+
+	target, _ := url.Parse(backend.URL)
+	sec := DefaultConfig().Security
+	sec.AllowedHosts = []string{"127.0.0.1"}
+	breaker := newCircuitBreaker(BreakerConfig{})
+
+	gzipReq := func() *http.Request {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.Header.Set("Accept-Encoding", "gzip")
+		return r
+	}
+	identityReq := func() *http.Request {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.Header.Set("Accept-Encoding", "identity")
+		return r
+	}
+
+	w1 := httptest.NewRecorder()
+	serveCached(w1, gzipReq(), target, sec, breaker)
+	if got := w1.Header().Get("X-Ghisa-Cache"); got != "MISS" {
+		t.Fatalf("expected MISS on first gzip request, got %q", got)
+	}
+
+	w2 := httptest.NewRecorder()
+	serveCached(w2, identityReq(), target, sec, breaker)
+	if got := w2.Header().Get("X-Ghisa-Cache"); got != "MISS" {
+		t.Fatalf("expected a distinct Vary variant to MISS rather than evict the other, got %q", got)
+	}
+	if w2.Body.String() != "encoded as identity" {
+		t.Errorf("expected the identity response, got %q", w2.Body.String())
+	}
+
+	w3 := httptest.NewRecorder()
+	serveCached(w3, gzipReq(), target, sec, breaker)
+	if got := w3.Header().Get("X-Ghisa-Cache"); got != "HIT" {
+		t.Errorf("expected the earlier gzip variant to still be cached, got %q", got)
+	}
+	if w3.Body.String() != "encoded as gzip" {
+		t.Errorf("expected the gzip response to have survived the identity fetch, got %q", w3.Body.String())
+	}
+
+	if atomic.LoadInt64(&hits) != 2 {
+		t.Errorf("expected exactly one upstream fetch per variant, got %d", hits)
+	}
+}
+
+func TestServeCachedStaleWhileRevalidate(t *testing.T) {
+	appCache = newInMemoryCache()
+	target, _ := url.Parse("http://cache.example.com/resource")
+	sec := DefaultConfig().Security
+
+	entry := &cacheEntry{
+		status:               http.StatusOK,
+		header:               http.Header{},
+		body:                 []byte("stale body"),
+		storedAt:             time.Now().Add(-2 * time.Second),
+		maxAge:               1 * time.Second,
+		staleWhileRevalidate: 10 * time.Second,
+	}
+	appCache.Set(cacheKey(http.MethodGet, target), entry)
+
+	w := httptest.NewRecorder()
+	serveCached(w, httptest.NewRequest(http.MethodGet, "/", nil), target, sec, newCircuitBreaker(BreakerConfig{}))
+
+	if got := w.Header().Get("X-Ghisa-Cache"); got != "REVALIDATED" {
+		t.Errorf("expected REVALIDATED for a stale-but-within-SWR entry, got %q", got)
+	}
+	if w.Body.String() != "stale body" {
+		t.Errorf("expected the stale body to be served immediately, got %q", w.Body.String())
+	}
+}
+
+func TestComputeCachePolicy(t *testing.T) {
+	resp := &http.Response{Header: http.Header{}}
+	resp.Header.Set("Cache-Control", "max-age=30, stale-while-revalidate=120, stale-if-error=300")
+
+	policy := computeCachePolicy(resp)
+	if policy.maxAge != 30*time.Second {
+		t.Errorf("expected max-age 30s, got %v", policy.maxAge)
+	}
+	if policy.staleWhileRevalidate != 120*time.Second {
+		t.Errorf("expected stale-while-revalidate 120s, got %v", policy.staleWhileRevalidate)
+	}
+	if policy.staleIfError != 300*time.Second {
+		t.Errorf("expected stale-if-error 300s, got %v", policy.staleIfError)
+	}
+}
+
+func TestComputeCachePolicyNoStore(t *testing.T) {
+	resp := &http.Response{Header: http.Header{}}
+	resp.Header.Set("Cache-Control", "no-store")
+
+	if !computeCachePolicy(resp).noStore {
+		t.Error("expected no-store to be honored")
+	}
+}
+
+func TestCacheKeyCanonicalizesQueryOrder(t *testing.T) {
+	a, _ := url.Parse("https://api.example.com/data?b=2&a=1")
+	b, _ := url.Parse("https://API.example.com/data?a=1&b=2")
+
+	if cacheKey(http.MethodGet, a) != cacheKey(http.MethodGet, b) {
+		t.Error("expected equivalent URLs to produce the same cache key regardless of query order or host case")
+	}
+}
+
+func TestSingleflightGroupCoalescesCalls(t *testing.T) {
+	g := newSingleflightGroup()
+	var calls int64
+
+	results := make(chan interface{}, 5)
+	for i := 0; i < 5; i++ {
+		go func() {
+			v, _, _ := g.Do("k", func() (interface{}, error) {
+				atomic.AddInt64(&calls, 1)
+				time.Sleep(10 * time.Millisecond)
+				return "done", nil
+			})
+			results <- v
+		}()
+	}
+	for i := 0; i < 5; i++ {
+		if <-results != "done" {
+			t.Error("expected all callers to receive the shared result")
+		}
+	}
+	if calls != 1 {
+		t.Errorf("expected exactly one underlying call, got %d", calls)
+	}
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+)
+
+// Config holds all operator-tunable policy for the ghisa proxy. It is loaded
+// once at startup from a JSON file (path taken from the GHISA_CONFIG
+// environment variable) and falls back to DefaultConfig when unset.
+type Config struct {
+	Security  SecurityConfig  `json:"security"`
+	Cors      CorsOptions     `json:"cors"`
+	RateLimit RateLimitConfig `json:"rate_limit"`
+	Breaker   BreakerConfig   `json:"breaker"`
+}
+
+// SecurityConfig controls which destinations proxyHandler is allowed to
+// reach. Hosts are checked against AllowedHosts/DeniedHosts glob patterns,
+// and every resolved IP is additionally checked against the built-in
+// private/reserved ranges in isDeniedIP, except for hosts that match an
+// AllowedHosts entry, which skip that check.
+type SecurityConfig struct {
+	// AllowedHosts is a list of host globs (e.g. "*.example.com") or CIDRs.
+	// Empty means "any host not otherwise denied".
+	AllowedHosts []string `json:"allowed_hosts"`
+	// DeniedHosts is a list of host globs or CIDRs checked before the
+	// built-in private-IP denylist.
+	DeniedHosts []string `json:"denied_hosts"`
+	// AllowedSchemes restricts the proxy target's URL scheme.
+	AllowedSchemes []string `json:"allowed_schemes"`
+	// MaxRequestBodyBytes and MaxResponseBodyBytes cap how much of the
+	// client request / upstream response ghisa will read, 0 means no limit.
+	// Responses buffered by the GET cache are still capped at 10MB when
+	// MaxResponseBodyBytes is 0.
+	MaxRequestBodyBytes  int64 `json:"max_request_body_bytes"`
+	MaxResponseBodyBytes int64 `json:"max_response_body_bytes"`
+	// RequestTimeout bounds the full round trip to the upstream target.
+	RequestTimeout Duration `json:"request_timeout"`
+}
+
+// Duration wraps time.Duration so config files can use Go-style strings
+// such as "30s" instead of raw nanosecond counts.
+type Duration struct {
+	time.Duration
+}
+
+// MarshalJSON implements json.Marshaler.
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.Duration.String())
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	parsed, err := time.ParseDuration(s)
+	if err != nil {
+		return fmt.Errorf("GHISA: invalid duration %q: %w", s, err)
+	}
+	d.Duration = parsed
+	return nil
+}
+
+// DefaultConfig returns the policy ghisa enforces when no config file is
+// supplied: http/https only, a 30s upstream timeout, a 10MB body cap, and
+// rate limiting / circuit breaking disabled (operators opt in per target).
+func DefaultConfig() Config {
+	return Config{
+		Security: SecurityConfig{
+			AllowedSchemes:       []string{"http", "https"},
+			MaxRequestBodyBytes:  10 << 20,
+			MaxResponseBodyBytes: 10 << 20,
+			RequestTimeout:       Duration{30 * time.Second},
+		},
+		Cors: DefaultCorsOptions(),
+	}
+}
+
+// LoadConfig reads the config file at path, falling back to DefaultConfig
+// when path is empty. An empty AllowedSchemes/RequestTimeout/body cap in the
+// loaded file is filled in from DefaultConfig so operators only need to
+// specify the fields they want to override.
+func LoadConfig(path string) (Config, error) {
+	cfg := DefaultConfig()
+	if path == "" {
+		return cfg, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Config{}, fmt.Errorf("GHISA: failed to read config %q: %w", path, err)
+	}
+
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return Config{}, fmt.Errorf("GHISA: failed to parse config %q: %w", path, err)
+	}
+
+	if len(cfg.Security.AllowedSchemes) == 0 {
+		cfg.Security.AllowedSchemes = DefaultConfig().Security.AllowedSchemes
+	}
+	if cfg.Security.RequestTimeout.Duration == 0 {
+		cfg.Security.RequestTimeout = DefaultConfig().Security.RequestTimeout
+	}
+	if len(cfg.Cors.AllowedMethods) == 0 {
+		cfg.Cors.AllowedMethods = DefaultCorsOptions().AllowedMethods
+	}
+
+	return cfg, nil
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// CorsOptions configures corsMiddleware. It is loaded from the same config
+// file as SecurityConfig so operators can lock ghisa to their frontend
+// origin instead of the open-to-the-world default.
+type CorsOptions struct {
+	// AllowedOrigins is a list of exact origins or glob patterns (e.g.
+	// "https://*.example.com"). "*" allows any origin.
+	AllowedOrigins []string `json:"allowed_origins"`
+	AllowedMethods []string `json:"allowed_methods"`
+	AllowedHeaders []string `json:"allowed_headers"`
+	ExposedHeaders []string `json:"exposed_headers"`
+	// AllowCredentials sets Access-Control-Allow-Credentials. Per the
+	// fetch spec this is incompatible with a wildcard origin, so when set
+	// the middleware always reflects the request's own Origin instead of
+	// emitting "*".
+	AllowCredentials bool `json:"allow_credentials"`
+	// MaxAge is the preflight cache lifetime, in seconds.
+	MaxAge int `json:"max_age_seconds"`
+}
+
+// DefaultCorsOptions preserves ghisa's historical open-to-the-world CORS
+// policy for operators who don't supply a config file.
+func DefaultCorsOptions() CorsOptions {
+	return CorsOptions{
+		AllowedOrigins: []string{"*"},
+		AllowedMethods: []string{"GET", "POST", "OPTIONS"},
+		AllowedHeaders: []string{"Content-Type"},
+		MaxAge:         600,
+	}
+}
+
+// corsMiddleware wraps next with CORS handling driven by opts: it sets
+// response headers for allowed simple requests and answers OPTIONS
+// preflights directly, echoing the requested method/headers only when they
+// match policy.
+func corsMiddleware(next http.Handler, opts CorsOptions) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		allowed := origin != "" && originAllowed(opts.AllowedOrigins, origin)
+
+		if allowed {
+			w.Header().Add("Vary", "Origin")
+			if opts.AllowCredentials {
+				w.Header().Set("Access-Control-Allow-Origin", origin)
+				w.Header().Set("Access-Control-Allow-Credentials", "true")
+			} else if containsOrigin(opts.AllowedOrigins, "*") {
+				w.Header().Set("Access-Control-Allow-Origin", "*")
+			} else {
+				w.Header().Set("Access-Control-Allow-Origin", origin)
+			}
+			if len(opts.ExposedHeaders) > 0 {
+				w.Header().Set("Access-Control-Expose-Headers", strings.Join(opts.ExposedHeaders, ", "))
+			}
+		}
+
+		if r.Method == http.MethodOptions {
+			handlePreflight(w, r, opts, allowed)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+func handlePreflight(w http.ResponseWriter, r *http.Request, opts CorsOptions, originOK bool) {
+	if !originOK {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+
+	if reqMethod := r.Header.Get("Access-Control-Request-Method"); reqMethod != "" {
+		if !containsFold(opts.AllowedMethods, reqMethod) {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		w.Header().Set("Access-Control-Allow-Methods", reqMethod)
+	} else {
+		w.Header().Set("Access-Control-Allow-Methods", strings.Join(opts.AllowedMethods, ", "))
+	}
+
+	if reqHeaders := r.Header.Get("Access-Control-Request-Headers"); reqHeaders != "" {
+		for _, h := range strings.Split(reqHeaders, ",") {
+			if !containsFold(opts.AllowedHeaders, strings.TrimSpace(h)) {
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+		}
+		w.Header().Set("Access-Control-Allow-Headers", reqHeaders)
+	} else {
+		w.Header().Set("Access-Control-Allow-Headers", strings.Join(opts.AllowedHeaders, ", "))
+	}
+
+	if opts.MaxAge > 0 {
+		w.Header().Set("Access-Control-Max-Age", strconv.Itoa(opts.MaxAge))
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func originAllowed(patterns []string, origin string) bool {
+	for _, p := range patterns {
+		if p == "*" {
+			return true
+		}
+		if matched, err := path.Match(p, origin); err == nil && matched {
+			return true
+		}
+	}
+	return false
+}
+
+func containsOrigin(patterns []string, origin string) bool {
+	for _, p := range patterns {
+		if p == origin {
+			return true
+		}
+	}
+	return false
+}
+
+func containsFold(list []string, value string) bool {
+	for _, item := range list {
+		if strings.EqualFold(item, value) {
+			return true
+		}
+	}
+	return false
+}
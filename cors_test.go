@@ -0,0 +1,113 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func passthroughHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+}
+
+func TestCorsMiddlewareSimpleRequest(t *testing.T) {
+	opts := DefaultCorsOptions()
+	handler := corsMiddleware(passthroughHandler(), opts)
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Origin", "https://app.example.com")
+	w := httptest.NewRecorder()
+
+	handler.ServeHTTP(w, req)
+
+	if w.Result().StatusCode != http.StatusOK {
+		t.Fatalf("expected request to reach the wrapped handler, got %d", w.Result().StatusCode)
+	}
+	if got := w.Header().Get("Access-Control-Allow-Origin"); got != "*" {
+		t.Errorf("expected wildcard origin, got %q", got)
+	}
+}
+
+func TestCorsMiddlewareCredentialsNeverReflectsWildcard(t *testing.T) {
+	opts := DefaultCorsOptions()
+	opts.AllowCredentials = true
+	handler := corsMiddleware(passthroughHandler(), opts)
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Origin", "https://app.example.com")
+	w := httptest.NewRecorder()
+
+	handler.ServeHTTP(w, req)
+
+	if got := w.Header().Get("Access-Control-Allow-Origin"); got != "https://app.example.com" {
+		t.Errorf("expected reflected origin with credentials, got %q", got)
+	}
+	if w.Header().Get("Access-Control-Allow-Credentials") != "true" {
+		t.Error("expected Access-Control-Allow-Credentials: true")
+	}
+}
+
+func TestCorsMiddlewareRejectsDisallowedOrigin(t *testing.T) {
+	opts := CorsOptions{AllowedOrigins: []string{"https://app.example.com"}, AllowedMethods: []string{"GET"}}
+	handler := corsMiddleware(passthroughHandler(), opts)
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Origin", "https://evil.example.com")
+	w := httptest.NewRecorder()
+
+	handler.ServeHTTP(w, req)
+
+	if w.Header().Get("Access-Control-Allow-Origin") != "" {
+		t.Error("expected no CORS headers for a disallowed origin")
+	}
+}
+
+func TestCorsMiddlewarePreflight(t *testing.T) {
+	opts := CorsOptions{
+		AllowedOrigins: []string{"https://app.example.com"},
+		AllowedMethods: []string{"GET", "POST"},
+		AllowedHeaders: []string{"Content-Type", "Authorization"},
+		MaxAge:         300,
+	}
+	handler := corsMiddleware(passthroughHandler(), opts)
+
+	req := httptest.NewRequest(http.MethodOptions, "/", nil)
+	req.Header.Set("Origin", "https://app.example.com")
+	req.Header.Set("Access-Control-Request-Method", "POST")
+	req.Header.Set("Access-Control-Request-Headers", "Content-Type")
+	w := httptest.NewRecorder()
+
+	handler.ServeHTTP(w, req)
+
+	resp := w.Result()
+	if resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("expected 204 for a valid preflight, got %d", resp.StatusCode)
+	}
+	if resp.Header.Get("Access-Control-Allow-Methods") != "POST" {
+		t.Errorf("unexpected Access-Control-Allow-Methods: %q", resp.Header.Get("Access-Control-Allow-Methods"))
+	}
+	if resp.Header.Get("Access-Control-Max-Age") != "300" {
+		t.Errorf("unexpected Access-Control-Max-Age: %q", resp.Header.Get("Access-Control-Max-Age"))
+	}
+}
+
+func TestCorsMiddlewarePreflightRejectsDisallowedMethod(t *testing.T) {
+	opts := CorsOptions{
+		AllowedOrigins: []string{"https://app.example.com"},
+		AllowedMethods: []string{"GET"},
+	}
+	handler := corsMiddleware(passthroughHandler(), opts)
+
+	req := httptest.NewRequest(http.MethodOptions, "/", nil)
+	req.Header.Set("Origin", "https://app.example.com")
+	req.Header.Set("Access-Control-Request-Method", "DELETE")
+	w := httptest.NewRecorder()
+
+	handler.ServeHTTP(w, req)
+
+	if w.Result().StatusCode != http.StatusForbidden {
+		t.Errorf("expected 403 for a disallowed preflight method, got %d", w.Result().StatusCode)
+	}
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// histogramBuckets are the upper bounds, in seconds, used for
+// ghisa_upstream_duration_seconds. They match the Prometheus client
+// libraries' own default buckets.
+var histogramBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+type histogram struct {
+	mu      sync.Mutex
+	buckets []uint64
+	sum     float64
+	count   uint64
+}
+
+func newHistogram() *histogram {
+	return &histogram{buckets: make([]uint64, len(histogramBuckets))}
+}
+
+func (h *histogram) observe(seconds float64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for i, bound := range histogramBuckets {
+		if seconds <= bound {
+			h.buckets[i]++
+		}
+	}
+	h.sum += seconds
+	h.count++
+}
+
+func (h *histogram) snapshot() (buckets []uint64, sum float64, count uint64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return append([]uint64(nil), h.buckets...), h.sum, h.count
+}
+
+type requestLabel struct {
+	method     string
+	status     int
+	targetHost string
+}
+
+// metricsRegistry accumulates the counters, histogram and gauges ghisa
+// exposes at /metrics. appMetrics is the single process-wide instance,
+// updated by MetricsMiddleware on every request.
+type metricsRegistry struct {
+	mu              sync.Mutex
+	requestsTotal   map[requestLabel]uint64
+	lastSeen        map[requestLabel]time.Time
+	upstreamLatency *histogram
+	inflight        int64
+	bytesIn         uint64
+	bytesOut        uint64
+}
+
+func newMetricsRegistry() *metricsRegistry {
+	return &metricsRegistry{
+		requestsTotal:   make(map[requestLabel]uint64),
+		lastSeen:        make(map[requestLabel]time.Time),
+		upstreamLatency: newHistogram(),
+	}
+}
+
+var appMetrics = newMetricsRegistry()
+
+func (m *metricsRegistry) recordRequest(method string, status int, targetHost string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	label := requestLabel{method, status, targetHost}
+	if _, ok := m.requestsTotal[label]; !ok {
+		sweepRequestLabelsLocked(m.requestsTotal, m.lastSeen)
+	}
+	m.requestsTotal[label]++
+	m.lastSeen[label] = time.Now()
+}
+
+// sweepRequestLabelsLocked evicts the least-recently-seen request labels
+// until requestsTotal has at most maxTrackedKeys/2 entries, mirroring
+// sweepLocked's bound on rateLimiterRegistry: target_host is the
+// attacker-controlled proxy target, so without a cap this map grows one
+// entry per distinct (method, status, host) combination forever. Callers
+// must hold mu.
+func sweepRequestLabelsLocked(requestsTotal map[requestLabel]uint64, lastSeen map[requestLabel]time.Time) {
+	if len(requestsTotal) <= maxTrackedKeys {
+		return
+	}
+	type idleKey struct {
+		label requestLabel
+		idle  time.Time
+	}
+	idled := make([]idleKey, 0, len(requestsTotal))
+	for l := range requestsTotal {
+		idled = append(idled, idleKey{l, lastSeen[l]})
+	}
+	sort.Slice(idled, func(i, j int) bool { return idled[i].idle.Before(idled[j].idle) })
+
+	evict := len(requestsTotal) - maxTrackedKeys/2
+	for i := 0; i < evict; i++ {
+		delete(requestsTotal, idled[i].label)
+		delete(lastSeen, idled[i].label)
+	}
+}
+
+func (m *metricsRegistry) addInflight(delta int64) {
+	atomic.AddInt64(&m.inflight, delta)
+}
+
+func (m *metricsRegistry) addBytes(direction string, n uint64) {
+	switch direction {
+	case "in":
+		atomic.AddUint64(&m.bytesIn, n)
+	case "out":
+		atomic.AddUint64(&m.bytesOut, n)
+	}
+}
+
+// metricsHandler renders the current metrics snapshot in Prometheus text
+// exposition format.
+func metricsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+
+	appMetrics.mu.Lock()
+	counts := make(map[requestLabel]uint64, len(appMetrics.requestsTotal))
+	for l, c := range appMetrics.requestsTotal {
+		counts[l] = c
+	}
+	appMetrics.mu.Unlock()
+
+	labels := make([]requestLabel, 0, len(counts))
+	for l := range counts {
+		labels = append(labels, l)
+	}
+	sort.Slice(labels, func(i, j int) bool {
+		if labels[i].targetHost != labels[j].targetHost {
+			return labels[i].targetHost < labels[j].targetHost
+		}
+		if labels[i].method != labels[j].method {
+			return labels[i].method < labels[j].method
+		}
+		return labels[i].status < labels[j].status
+	})
+
+	var b strings.Builder
+
+	fmt.Fprintln(&b, "# HELP ghisa_requests_total Total number of proxied requests.")
+	fmt.Fprintln(&b, "# TYPE ghisa_requests_total counter")
+	for _, l := range labels {
+		fmt.Fprintf(&b, "ghisa_requests_total{method=%q,status=%q,target_host=%q} %d\n",
+			l.method, strconv.Itoa(l.status), l.targetHost, counts[l])
+	}
+
+	fmt.Fprintln(&b, "# HELP ghisa_upstream_duration_seconds Latency of proxied requests.")
+	fmt.Fprintln(&b, "# TYPE ghisa_upstream_duration_seconds histogram")
+	buckets, sum, count := appMetrics.upstreamLatency.snapshot()
+	for i, bound := range histogramBuckets {
+		fmt.Fprintf(&b, "ghisa_upstream_duration_seconds_bucket{le=%q} %d\n", strconv.FormatFloat(bound, 'f', -1, 64), buckets[i])
+	}
+	fmt.Fprintf(&b, "ghisa_upstream_duration_seconds_bucket{le=\"+Inf\"} %d\n", count)
+	fmt.Fprintf(&b, "ghisa_upstream_duration_seconds_sum %s\n", strconv.FormatFloat(sum, 'f', -1, 64))
+	fmt.Fprintf(&b, "ghisa_upstream_duration_seconds_count %d\n", count)
+
+	fmt.Fprintln(&b, "# HELP ghisa_inflight_requests Requests currently being proxied.")
+	fmt.Fprintln(&b, "# TYPE ghisa_inflight_requests gauge")
+	fmt.Fprintf(&b, "ghisa_inflight_requests %d\n", atomic.LoadInt64(&appMetrics.inflight))
+
+	fmt.Fprintln(&b, "# HELP ghisa_bytes_transferred_total Bytes transferred through the proxy.")
+	fmt.Fprintln(&b, "# TYPE ghisa_bytes_transferred_total counter")
+	fmt.Fprintf(&b, "ghisa_bytes_transferred_total{direction=\"in\"} %d\n", atomic.LoadUint64(&appMetrics.bytesIn))
+	fmt.Fprintf(&b, "ghisa_bytes_transferred_total{direction=\"out\"} %d\n", atomic.LoadUint64(&appMetrics.bytesOut))
+
+	fmt.Fprintln(&b, "# HELP ghisa_circuit_breaker_state Per-target breaker state (0=closed, 1=open, 2=half-open).")
+	fmt.Fprintln(&b, "# TYPE ghisa_circuit_breaker_state gauge")
+	states := appBreakers.snapshot()
+	hosts := make([]string, 0, len(states))
+	for host := range states {
+		hosts = append(hosts, host)
+	}
+	sort.Strings(hosts)
+	for _, host := range hosts {
+		fmt.Fprintf(&b, "ghisa_circuit_breaker_state{target_host=%q} %d\n", host, states[host])
+	}
+
+	w.Write([]byte(b.String()))
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"runtime/debug"
+	"time"
+)
+
+// slogLogger is ghisa's structured access logger: one JSON line per request.
+var slogLogger = slog.New(slog.NewJSONHandler(os.Stdout, nil))
+
+// statusRecorder wraps an http.ResponseWriter to capture the status code and
+// byte count written, for logging and metrics middleware. It forwards
+// Hijack so the WebSocket upgrade path in serveWebSocket keeps working
+// underneath the middleware stack.
+type statusRecorder struct {
+	http.ResponseWriter
+	status      int
+	bytesOut    int64
+	wroteHeader bool
+}
+
+func (rec *statusRecorder) WriteHeader(code int) {
+	if rec.wroteHeader {
+		return
+	}
+	rec.status = code
+	rec.wroteHeader = true
+	rec.ResponseWriter.WriteHeader(code)
+}
+
+func (rec *statusRecorder) Write(b []byte) (int, error) {
+	if !rec.wroteHeader {
+		rec.WriteHeader(http.StatusOK)
+	}
+	n, err := rec.ResponseWriter.Write(b)
+	rec.bytesOut += int64(n)
+	return n, err
+}
+
+func (rec *statusRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := rec.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, fmt.Errorf("GHISA: underlying ResponseWriter does not support hijacking")
+	}
+	return hijacker.Hijack()
+}
+
+func generateRequestID() string {
+	buf := make([]byte, 8)
+	if _, err := rand.Read(buf); err != nil {
+		return fmt.Sprintf("%d", time.Now().UnixNano())
+	}
+	return hex.EncodeToString(buf)
+}
+
+// targetHostOf extracts the proxy target's host from the "url" query
+// parameter, for logging and metrics labels. It returns "" for malformed or
+// missing targets rather than erroring, since this is best-effort telemetry.
+func targetHostOf(r *http.Request) string {
+	raw := r.URL.Query().Get("url")
+	if raw == "" {
+		return ""
+	}
+	parsed, err := url.Parse(raw)
+	if err != nil {
+		return ""
+	}
+	return parsed.Hostname()
+}
+
+// RecoveryMiddleware logs a panic's stack trace and returns 500 instead of
+// crashing the server.
+func RecoveryMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer func() {
+			if rec := recover(); rec != nil {
+				slogLogger.Error("GHISA: panic recovered", "error", fmt.Sprintf("%v", rec), "stack", string(debug.Stack()))
+				http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			}
+		}()
+		next.ServeHTTP(w, r)
+	})
+}
+
+// LoggingMiddleware emits one structured JSON log line per request and
+// ensures every request carries an X-Request-ID, generating one if the
+// client didn't send it and forwarding it upstream via r.Header.
+func LoggingMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestID := r.Header.Get("X-Request-ID")
+		if requestID == "" {
+			requestID = generateRequestID()
+			r.Header.Set("X-Request-ID", requestID)
+		}
+		w.Header().Set("X-Request-ID", requestID)
+
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		start := time.Now()
+
+		next.ServeHTTP(rec, r)
+
+		slogLogger.Info("GHISA: request",
+			"request_id", requestID,
+			"method", r.Method,
+			"target_host", targetHostOf(r),
+			"status", rec.status,
+			"bytes_in", r.ContentLength,
+			"bytes_out", rec.bytesOut,
+			"duration_ms", time.Since(start).Milliseconds(),
+		)
+	})
+}
+
+// MetricsMiddleware updates appMetrics with in-flight count, per-request
+// counters and bytes transferred, so they can be scraped at /metrics.
+func MetricsMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		appMetrics.addInflight(1)
+		defer appMetrics.addInflight(-1)
+
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		start := time.Now()
+
+		next.ServeHTTP(rec, r)
+
+		appMetrics.upstreamLatency.observe(time.Since(start).Seconds())
+		appMetrics.recordRequest(r.Method, rec.status, targetHostOf(r))
+		appMetrics.addBytes("out", uint64(rec.bytesOut))
+		if r.ContentLength > 0 {
+			appMetrics.addBytes("in", uint64(r.ContentLength))
+		}
+	})
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestLoggingMiddlewareGeneratesRequestID(t *testing.T) {
+	handler := LoggingMiddleware(passthroughHandler())
+
+	req := httptest.NewRequest(http.MethodGet, "/?url=http://example.com", nil)
+	w := httptest.NewRecorder()
+
+	handler.ServeHTTP(w, req)
+
+	id := w.Header().Get("X-Request-ID")
+	if id == "" {
+		t.Fatal("expected a generated X-Request-ID header")
+	}
+	if req.Header.Get("X-Request-ID") != id {
+		t.Error("expected the request ID to be forwarded on the request for upstream propagation")
+	}
+}
+
+func TestLoggingMiddlewarePreservesIncomingRequestID(t *testing.T) {
+	handler := LoggingMiddleware(passthroughHandler())
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("X-Request-ID", "client-supplied-id")
+	w := httptest.NewRecorder()
+
+	handler.ServeHTTP(w, req)
+
+	if got := w.Header().Get("X-Request-ID"); got != "client-supplied-id" {
+		t.Errorf("expected client-supplied request ID to be preserved, got %q", got)
+	}
+}
+
+func TestRecoveryMiddlewareRecoversPanic(t *testing.T) {
+	panicking := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic("boom")
+	})
+	handler := RecoveryMiddleware(panicking)
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	w := httptest.NewRecorder()
+
+	handler.ServeHTTP(w, req)
+
+	if w.Result().StatusCode != http.StatusInternalServerError {
+		t.Errorf("expected 500 after recovering a panic, got %d", w.Result().StatusCode)
+	}
+}
+
+func TestMetricsMiddlewareRecordsRequest(t *testing.T) {
+	appMetrics = newMetricsRegistry()
+	handler := MetricsMiddleware(passthroughHandler())
+
+	req := httptest.NewRequest(http.MethodGet, "/?url=http://example.com", nil)
+	w := httptest.NewRecorder()
+
+	handler.ServeHTTP(w, req)
+
+	appMetrics.mu.Lock()
+	count := appMetrics.requestsTotal[requestLabel{method: http.MethodGet, status: http.StatusOK, targetHost: "example.com"}]
+	appMetrics.mu.Unlock()
+
+	if count != 1 {
+		t.Errorf("expected 1 recorded request, got %d", count)
+	}
+}
+
+func TestMetricsHandlerRendersPrometheusFormat(t *testing.T) {
+	appMetrics = newMetricsRegistry()
+	appMetrics.recordRequest(http.MethodGet, http.StatusOK, "example.com")
+
+	req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+	w := httptest.NewRecorder()
+
+	metricsHandler(w, req)
+
+	body := w.Body.String()
+	for _, want := range []string{"ghisa_requests_total", "ghisa_upstream_duration_seconds", "ghisa_inflight_requests", "ghisa_bytes_transferred_total"} {
+		if !strings.Contains(body, want) {
+			t.Errorf("expected /metrics output to contain %q", want)
+		}
+	}
+}
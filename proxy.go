@@ -0,0 +1,214 @@
+package main
+
+import (
+	"bytes"
+	"crypto/tls"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// hopByHopHeaders are stripped before forwarding a request or response, per
+// RFC 7230 section 6.1 — they describe the connection to the immediate peer
+// and must never be forwarded by a proxy.
+var hopByHopHeaders = []string{
+	"Connection",
+	"Keep-Alive",
+	"Proxy-Authenticate",
+	"Proxy-Authorization",
+	"TE",
+	"Trailer",
+	"Transfer-Encoding",
+	"Upgrade",
+}
+
+func stripHopByHopHeaders(h http.Header) {
+	for _, name := range hopByHopHeaders {
+		h.Del(name)
+	}
+}
+
+// errResponseTooLarge is returned when an upstream response body exceeds
+// SecurityConfig.MaxResponseBodyBytes. ghisa rejects it outright instead of
+// silently truncating the body while leaving the upstream's original
+// Content-Length in place, which would hand the client a corrupted,
+// short-read download.
+var errResponseTooLarge = errors.New("upstream response exceeds the configured size limit")
+
+// readWithinLimit reads r fully, bounded to limit+1 bytes so ghisa never
+// buffers more than the configured cap regardless of how large the
+// upstream response actually is, and reports errResponseTooLarge if that
+// bound is exceeded.
+func readWithinLimit(r io.Reader, limit int64) ([]byte, error) {
+	body, err := io.ReadAll(io.LimitReader(r, limit+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(body)) > limit {
+		return nil, errResponseTooLarge
+	}
+	return body, nil
+}
+
+// isWebSocketUpgrade reports whether r is an HTTP/1.1 Upgrade request for a
+// websocket connection, which ReverseProxy cannot stream and must instead be
+// handled by hijacking the underlying connection.
+func isWebSocketUpgrade(r *http.Request) bool {
+	return strings.EqualFold(r.Header.Get("Upgrade"), "websocket") &&
+		strings.Contains(strings.ToLower(r.Header.Get("Connection")), "upgrade")
+}
+
+// appendForwardedFor adds clientIP to an existing X-Forwarded-For chain.
+func appendForwardedFor(existing, clientIP string) string {
+	if existing == "" {
+		return clientIP
+	}
+	return existing + ", " + clientIP
+}
+
+func schemeOf(r *http.Request) string {
+	if r.TLS != nil {
+		return "https"
+	}
+	return "http"
+}
+
+// newReverseProxy builds an httputil.ReverseProxy for a single proxied
+// request's target. It streams the request body instead of buffering it,
+// strips hop-by-hop headers, rewrites Host to the target and sets
+// X-Forwarded-For/-Proto/-Host to reflect the real client. The response body
+// is streamed only when sec.MaxResponseBodyBytes is 0; otherwise it is read
+// into memory (up to that cap) before anything is sent to the client.
+func newReverseProxy(target *url.URL, sec SecurityConfig) *httputil.ReverseProxy {
+	return &httputil.ReverseProxy{
+		Transport: &http.Transport{DialContext: safeDialContext(sec)},
+		Director: func(req *http.Request) {
+			clientHost := req.Host
+			forwardedProto := schemeOf(req)
+
+			req.URL.Scheme = target.Scheme
+			req.URL.Host = target.Host
+			req.URL.Path = target.Path
+			req.URL.RawQuery = target.RawQuery
+			req.Host = target.Host
+
+			stripHopByHopHeaders(req.Header)
+			// X-Forwarded-For is left to ReverseProxy itself, which appends the
+			// client IP to any existing chain after Director returns.
+			req.Header.Set("X-Forwarded-Proto", forwardedProto)
+			req.Header.Set("X-Forwarded-Host", clientHost)
+		},
+		ModifyResponse: func(resp *http.Response) error {
+			stripHopByHopHeaders(resp.Header)
+			if sec.MaxResponseBodyBytes > 0 {
+				body, err := readWithinLimit(resp.Body, sec.MaxResponseBodyBytes)
+				resp.Body.Close()
+				if err != nil {
+					return err
+				}
+				resp.Body = io.NopCloser(bytes.NewReader(body))
+				resp.ContentLength = int64(len(body))
+				resp.Header.Set("Content-Length", strconv.Itoa(len(body)))
+			}
+			return nil
+		},
+		ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error) {
+			var forbidden *ForbiddenTargetError
+			if errors.As(err, &forbidden) {
+				writeForbiddenTarget(w, forbidden)
+				return
+			}
+			if errors.Is(err, errResponseTooLarge) {
+				http.Error(w, "GHISA: Upstream response exceeds the configured size limit", http.StatusRequestEntityTooLarge)
+				return
+			}
+			http.Error(w, "GHISA: Failed to make request", http.StatusBadGateway)
+		},
+	}
+}
+
+// serveWebSocket handles an HTTP/1.1 Upgrade request by dialing target
+// directly (through the same SSRF-checked dialer as the regular proxy path),
+// replaying the client's handshake, and then copying bytes bidirectionally
+// for the lifetime of the connection. ReverseProxy cannot do this itself
+// since it expects a single request/response, not a long-lived duplex
+// stream.
+func serveWebSocket(w http.ResponseWriter, r *http.Request, target *url.URL, sec SecurityConfig) {
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		http.Error(w, "GHISA: WebSocket upgrade not supported", http.StatusInternalServerError)
+		return
+	}
+
+	dial := safeDialContext(sec)
+	tlsUpstream := target.Scheme == "https" || target.Scheme == "wss"
+	port := target.Port()
+	if port == "" {
+		if tlsUpstream {
+			port = "443"
+		} else {
+			port = "80"
+		}
+	}
+	upstream, err := dial(r.Context(), "tcp", net.JoinHostPort(target.Hostname(), port))
+	if err != nil {
+		var forbidden *ForbiddenTargetError
+		if errors.As(err, &forbidden) {
+			writeForbiddenTarget(w, forbidden)
+			return
+		}
+		http.Error(w, "GHISA: Failed to reach upstream", http.StatusBadGateway)
+		return
+	}
+	defer upstream.Close()
+
+	if tlsUpstream {
+		tlsConn := tls.Client(upstream, &tls.Config{ServerName: target.Hostname()})
+		if err := tlsConn.HandshakeContext(r.Context()); err != nil {
+			http.Error(w, "GHISA: TLS handshake with upstream failed", http.StatusBadGateway)
+			return
+		}
+		upstream = tlsConn
+	}
+
+	outbound := r.Clone(r.Context())
+	outbound.URL.Scheme = target.Scheme
+	outbound.URL.Host = target.Host
+	outbound.URL.Path = target.Path
+	outbound.URL.RawQuery = target.RawQuery
+	outbound.Host = target.Host
+	outbound.RequestURI = ""
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		outbound.Header.Set("X-Forwarded-For", appendForwardedFor(outbound.Header.Get("X-Forwarded-For"), host))
+	}
+	outbound.Header.Set("X-Forwarded-Proto", schemeOf(r))
+	outbound.Header.Set("X-Forwarded-Host", r.Host)
+
+	if err := outbound.Write(upstream); err != nil {
+		http.Error(w, "GHISA: Failed to relay handshake", http.StatusBadGateway)
+		return
+	}
+
+	client, buf, err := hijacker.Hijack()
+	if err != nil {
+		http.Error(w, "GHISA: Failed to hijack connection", http.StatusInternalServerError)
+		return
+	}
+	defer client.Close()
+
+	if buf.Reader.Buffered() > 0 {
+		if _, err := io.CopyN(upstream, buf.Reader, int64(buf.Reader.Buffered())); err != nil {
+			return
+		}
+	}
+
+	done := make(chan struct{}, 2)
+	go func() { io.Copy(upstream, client); done <- struct{}{} }()
+	go func() { io.Copy(client, upstream); done <- struct{}{} }()
+	<-done
+}
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"bufio"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestIsWebSocketUpgrade(t *testing.T) {
+	req := httptestRequest()
+	if isWebSocketUpgrade(req) {
+		t.Error("plain request should not be detected as a websocket upgrade")
+	}
+
+	req.Header.Set("Upgrade", "websocket")
+	req.Header.Set("Connection", "Upgrade")
+	if !isWebSocketUpgrade(req) {
+		t.Error("expected Upgrade: websocket request to be detected")
+	}
+}
+
+func TestAppendForwardedFor(t *testing.T) {
+	if got := appendForwardedFor("", "1.2.3.4"); got != "1.2.3.4" {
+		t.Errorf("expected bare client IP, got %q", got)
+	}
+	if got := appendForwardedFor("1.2.3.4", "5.6.7.8"); got != "1.2.3.4, 5.6.7.8" {
+		t.Errorf("expected appended chain, got %q", got)
+	}
+}
+
+func TestStripHopByHopHeaders(t *testing.T) {
+	h := http.Header{}
+	h.Set("Connection", "keep-alive")
+	h.Set("Transfer-Encoding", "chunked")
+	h.Set("Content-Type", "application/json")
+
+	stripHopByHopHeaders(h)
+
+	if h.Get("Connection") != "" || h.Get("Transfer-Encoding") != "" {
+		t.Error("expected hop-by-hop headers to be stripped")
+	}
+	if h.Get("Content-Type") != "application/json" {
+		t.Error("expected end-to-end headers to survive stripping")
+	}
+}
+
+func httptestRequest() *http.Request {
+	req, _ := http.NewRequest(http.MethodGet, "http://example.com/", nil)
+	return req
+}
+
+// TestServeWebSocketProxiesBothDirections drives the full proxyHandler path
+// (hijack, dial through safeDialContext, TLS handshake for a wss/https
+// upstream, bidirectional copy) with a real Upgrade: websocket request
+// against both a plain and a TLS httptest backend, since none of the
+// narrower helper tests above exercise serveWebSocket itself.
+func TestServeWebSocketProxiesBothDirections(t *testing.T) {
+	for _, useTLS := range []bool{false, true} {
+		useTLS := useTLS
+		name := "plain"
+		if useTLS {
+			name = "tls"
+		}
+
+		t.Run(name, func(t *testing.T) {
+			backend := newEchoWebSocketServer(useTLS)
+			defer backend.Close()
+			if useTLS {
+				trustTestServerCert(t, backend)
+			}
+
+			appConfig.Security.AllowedHosts = []string{"127.0.0.1", "::1"}
+			t.Cleanup(func() { appConfig.Security.AllowedHosts = nil })
+
+			ghisa := httptest.NewServer(http.HandlerFunc(proxyHandler))
+			defer ghisa.Close()
+
+			conn, err := net.Dial("tcp", ghisa.Listener.Addr().String())
+			if err != nil {
+				t.Fatalf("dial ghisa: %v", err)
+			}
+			defer conn.Close()
+
+			handshake := fmt.Sprintf("GET /?url=%s HTTP/1.1\r\nHost: %s\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n\r\n",
+				url.QueryEscape(backend.URL), ghisa.Listener.Addr().String())
+			if _, err := conn.Write([]byte(handshake)); err != nil {
+				t.Fatalf("write handshake: %v", err)
+			}
+
+			reader := bufio.NewReader(conn)
+			statusLine, err := reader.ReadString('\n')
+			if err != nil {
+				t.Fatalf("read status line: %v", err)
+			}
+			if !strings.Contains(statusLine, "101") {
+				t.Fatalf("expected 101 Switching Protocols, got %q", statusLine)
+			}
+			for {
+				line, err := reader.ReadString('\n')
+				if err != nil {
+					t.Fatalf("read handshake headers: %v", err)
+				}
+				if line == "\r\n" {
+					break
+				}
+			}
+
+			payload := []byte("hello ghisa")
+			if _, err := conn.Write(payload); err != nil {
+				t.Fatalf("write payload: %v", err)
+			}
+
+			echoed := make([]byte, len(payload))
+			if _, err := io.ReadFull(reader, echoed); err != nil {
+				t.Fatalf("read echo: %v", err)
+			}
+			if string(echoed) != string(payload) {
+				t.Errorf("expected echoed payload %q, got %q", payload, echoed)
+			}
+		})
+	}
+}
+
+// newEchoWebSocketServer returns an httptest backend that completes an
+// HTTP/1.1 Upgrade handshake by hijacking the connection, then echoes
+// whatever raw bytes it receives back to the same connection.
+func newEchoWebSocketServer(useTLS bool) *httptest.Server {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hijacker, ok := w.(http.Hijacker)
+		if !ok {
+			http.Error(w, "hijack not supported", http.StatusInternalServerError)
+			return
+		}
+		conn, _, err := hijacker.Hijack()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		conn.Write([]byte("HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n\r\n"))
+
+		buf := make([]byte, 4096)
+		for {
+			n, err := conn.Read(buf)
+			if n > 0 {
+				if _, werr := conn.Write(buf[:n]); werr != nil {
+					return
+				}
+			}
+			if err != nil {
+				return
+			}
+		}
+	})
+
+	if useTLS {
+		return httptest.NewTLSServer(handler)
+	}
+	return httptest.NewServer(handler)
+}
+
+// trustTestServerCert makes ghisa's outbound TLS dialer (which verifies
+// against the system root pool, since serveWebSocket doesn't accept a
+// custom CA) trust s's self-signed certificate, by pointing SSL_CERT_FILE
+// at it for the duration of the test.
+func trustTestServerCert(t *testing.T, s *httptest.Server) {
+	t.Helper()
+
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: s.Certificate().Raw})
+	path := filepath.Join(t.TempDir(), "test-backend-ca.pem")
+	if err := os.WriteFile(path, certPEM, 0o600); err != nil {
+		t.Fatalf("write temp CA file: %v", err)
+	}
+
+	old, hadOld := os.LookupEnv("SSL_CERT_FILE")
+	os.Setenv("SSL_CERT_FILE", path)
+	t.Cleanup(func() {
+		if hadOld {
+			os.Setenv("SSL_CERT_FILE", old)
+		} else {
+			os.Unsetenv("SSL_CERT_FILE")
+		}
+	})
+}
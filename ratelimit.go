@@ -0,0 +1,191 @@
+package main
+
+import (
+	"math"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RateLimitConfig configures the token-bucket limits RateLimitMiddleware
+// enforces per client IP and per upstream target host. A zero RPS disables
+// that dimension of limiting.
+type RateLimitConfig struct {
+	ClientRPS   float64 `json:"client_rps"`
+	ClientBurst int     `json:"client_burst"`
+	TargetRPS   float64 `json:"target_rps"`
+	TargetBurst int     `json:"target_burst"`
+	// TrustForwardedFor keys the client-side limiter on the leftmost
+	// X-Forwarded-For address instead of the TCP peer, for deployments
+	// behind a trusted load balancer.
+	TrustForwardedFor bool `json:"trust_forwarded_for"`
+}
+
+// tokenBucket is a minimal token-bucket rate limiter (requests/second with
+// a burst allowance), equivalent in behavior to golang.org/x/time/rate.
+type tokenBucket struct {
+	mu         sync.Mutex
+	rate       float64
+	burst      float64
+	tokens     float64
+	lastRefill time.Time
+	lastUsed   time.Time
+}
+
+func newTokenBucket(rps float64, burst int) *tokenBucket {
+	if burst <= 0 {
+		burst = 1
+	}
+	now := time.Now()
+	return &tokenBucket{rate: rps, burst: float64(burst), tokens: float64(burst), lastRefill: now, lastUsed: now}
+}
+
+func (b *tokenBucket) allow() (bool, time.Duration) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := time.Now()
+	b.tokens = math.Min(b.burst, b.tokens+now.Sub(b.lastRefill).Seconds()*b.rate)
+	b.lastRefill = now
+	b.lastUsed = now
+
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+	if b.rate <= 0 {
+		return false, time.Second
+	}
+	return false, time.Duration((1 - b.tokens) / b.rate * float64(time.Second))
+}
+
+func (b *tokenBucket) idleSince() time.Time {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.lastUsed
+}
+
+// maxTrackedKeys bounds how many distinct client/target buckets a registry
+// keeps at once. Without this, an attacker who can vary their key (e.g. the
+// X-Forwarded-For address under TrustForwardedFor) could grow the map
+// without bound; bucketFor sweeps the oldest-idle entries once the cap is
+// exceeded.
+const maxTrackedKeys = 10000
+
+// sweepLocked evicts the least-recently-used buckets until buckets has at
+// most maxTrackedKeys/2 entries. Callers must hold mu.
+func sweepLocked(buckets map[string]*tokenBucket) {
+	if len(buckets) <= maxTrackedKeys {
+		return
+	}
+	type idleKey struct {
+		key  string
+		idle time.Time
+	}
+	idled := make([]idleKey, 0, len(buckets))
+	for k, b := range buckets {
+		idled = append(idled, idleKey{k, b.idleSince()})
+	}
+	sort.Slice(idled, func(i, j int) bool { return idled[i].idle.Before(idled[j].idle) })
+
+	evict := len(buckets) - maxTrackedKeys/2
+	for i := 0; i < evict; i++ {
+		delete(buckets, idled[i].key)
+	}
+}
+
+// rateLimiterRegistry lazily creates one tokenBucket per client/target key.
+type rateLimiterRegistry struct {
+	cfg     RateLimitConfig
+	mu      sync.Mutex
+	clients map[string]*tokenBucket
+	targets map[string]*tokenBucket
+}
+
+func newRateLimiterRegistry(cfg RateLimitConfig) *rateLimiterRegistry {
+	return &rateLimiterRegistry{cfg: cfg, clients: make(map[string]*tokenBucket), targets: make(map[string]*tokenBucket)}
+}
+
+func (r *rateLimiterRegistry) allowClient(key string) (bool, time.Duration) {
+	if r.cfg.ClientRPS <= 0 {
+		return true, 0
+	}
+	return bucketFor(&r.mu, r.clients, key, r.cfg.ClientRPS, r.cfg.ClientBurst).allow()
+}
+
+func (r *rateLimiterRegistry) allowTarget(key string) (bool, time.Duration) {
+	if r.cfg.TargetRPS <= 0 {
+		return true, 0
+	}
+	return bucketFor(&r.mu, r.targets, key, r.cfg.TargetRPS, r.cfg.TargetBurst).allow()
+}
+
+func bucketFor(mu *sync.Mutex, buckets map[string]*tokenBucket, key string, rps float64, burst int) *tokenBucket {
+	mu.Lock()
+	defer mu.Unlock()
+	b, ok := buckets[key]
+	if !ok {
+		sweepLocked(buckets)
+		b = newTokenBucket(rps, burst)
+		buckets[key] = b
+	}
+	return b
+}
+
+// appRateLimiter is the process-wide rate limiter, (re)configured in main
+// from the loaded Config.
+var appRateLimiter = newRateLimiterRegistry(RateLimitConfig{})
+
+// clientKeyOf picks the key a client is rate-limited on: the leftmost
+// X-Forwarded-For address when TrustForwardedFor is set, otherwise the TCP
+// peer address.
+func clientKeyOf(r *http.Request, cfg RateLimitConfig) string {
+	if cfg.TrustForwardedFor {
+		if xff := r.Header.Get("X-Forwarded-For"); xff != "" {
+			if first, _, found := strings.Cut(xff, ","); found || first != "" {
+				return strings.TrimSpace(first)
+			}
+		}
+	}
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		return host
+	}
+	return r.RemoteAddr
+}
+
+// RateLimitMiddleware enforces both the per-client and per-target-host
+// token buckets before a request reaches the proxy handler, responding 429
+// with Retry-After when either is exhausted. /health and /metrics are
+// operational endpoints, not proxied traffic, so they're exempt.
+func RateLimitMiddleware(next http.Handler, limiter *rateLimiterRegistry) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/health" || r.URL.Path == "/metrics" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if ok, retryAfter := limiter.allowClient(clientKeyOf(r, limiter.cfg)); !ok {
+			writeRateLimited(w, retryAfter)
+			return
+		}
+		if host := targetHostOf(r); host != "" {
+			if ok, retryAfter := limiter.allowTarget(host); !ok {
+				writeRateLimited(w, retryAfter)
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func writeRateLimited(w http.ResponseWriter, retryAfter time.Duration) {
+	secs := int(math.Ceil(retryAfter.Seconds()))
+	if secs < 1 {
+		secs = 1
+	}
+	w.Header().Set("Retry-After", strconv.Itoa(secs))
+	http.Error(w, "GHISA: Rate limit exceeded", http.StatusTooManyRequests)
+}
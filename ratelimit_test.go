@@ -0,0 +1,58 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestTokenBucketAllowsBurstThenLimits(t *testing.T) {
+	b := newTokenBucket(1, 2)
+
+	if ok, _ := b.allow(); !ok {
+		t.Fatal("expected first request within burst to be allowed")
+	}
+	if ok, _ := b.allow(); !ok {
+		t.Fatal("expected second request within burst to be allowed")
+	}
+	if ok, retryAfter := b.allow(); ok || retryAfter <= 0 {
+		t.Fatalf("expected third request to be rate limited with a positive Retry-After, got ok=%v retryAfter=%v", ok, retryAfter)
+	}
+}
+
+func TestRateLimitMiddlewareRejectsOverLimit(t *testing.T) {
+	limiter := newRateLimiterRegistry(RateLimitConfig{ClientRPS: 1, ClientBurst: 1})
+	handler := RateLimitMiddleware(passthroughHandler(), limiter)
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.RemoteAddr = "10.0.0.1:1234"
+
+	w1 := httptest.NewRecorder()
+	handler.ServeHTTP(w1, req)
+	if w1.Result().StatusCode != http.StatusOK {
+		t.Fatalf("expected first request to pass, got %d", w1.Result().StatusCode)
+	}
+
+	w2 := httptest.NewRecorder()
+	handler.ServeHTTP(w2, req)
+	if w2.Result().StatusCode != http.StatusTooManyRequests {
+		t.Fatalf("expected second request to be rate limited, got %d", w2.Result().StatusCode)
+	}
+	if w2.Header().Get("Retry-After") == "" {
+		t.Error("expected a Retry-After header on a 429")
+	}
+}
+
+func TestRateLimitMiddlewareDisabledByDefault(t *testing.T) {
+	limiter := newRateLimiterRegistry(RateLimitConfig{})
+	handler := RateLimitMiddleware(passthroughHandler(), limiter)
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	for i := 0; i < 10; i++ {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		if w.Result().StatusCode != http.StatusOK {
+			t.Fatalf("expected unlimited requests to always pass, got %d on iteration %d", w.Result().StatusCode, i)
+		}
+	}
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+)
+
+// ForbiddenTargetError is returned when a proxy target is rejected by
+// SecurityConfig, either at URL-validation time or, for DNS rebinding
+// attempts, while dialing. It is surfaced to the client as a 403 with a
+// structured JSON body.
+type ForbiddenTargetError struct {
+	Target string
+	Reason string
+}
+
+func (e *ForbiddenTargetError) Error() string {
+	return fmt.Sprintf("GHISA: target %q rejected: %s", e.Target, e.Reason)
+}
+
+func writeForbiddenTarget(w http.ResponseWriter, err *ForbiddenTargetError) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusForbidden)
+	fmt.Fprintf(w, `{"error":"forbidden_target","target":%q,"reason":%q}`, err.Target, err.Reason)
+}
+
+// checkURLPolicy validates a proxy target's scheme and host against
+// SecurityConfig before ghisa attempts to dial it. Host-level IP checks
+// (which require DNS resolution) happen later in safeDialContext.
+func checkURLPolicy(sec SecurityConfig, target *url.URL) *ForbiddenTargetError {
+	if target.Host == "" {
+		return &ForbiddenTargetError{Target: target.String(), Reason: "missing host"}
+	}
+
+	if !schemeAllowed(sec.AllowedSchemes, target.Scheme) {
+		return &ForbiddenTargetError{Target: target.String(), Reason: fmt.Sprintf("scheme %q not allowed", target.Scheme)}
+	}
+
+	host := target.Hostname()
+
+	if hostMatchesAny(sec.DeniedHosts, host) {
+		return &ForbiddenTargetError{Target: target.String(), Reason: "host is denylisted"}
+	}
+
+	if len(sec.AllowedHosts) > 0 {
+		// An explicit allowlist entry is an operator override: it is trusted
+		// even if it falls inside the built-in private-range denylist below
+		// (e.g. proxying to a known internal service on purpose).
+		if hostMatchesAny(sec.AllowedHosts, host) {
+			return nil
+		}
+		return &ForbiddenTargetError{Target: target.String(), Reason: "host is not in the allowlist"}
+	}
+
+	// A target given as a literal IP is checked immediately; hostnames are
+	// re-checked per resolved IP in safeDialContext to defeat DNS rebinding.
+	if ip := net.ParseIP(host); ip != nil && isDeniedIP(ip) {
+		return &ForbiddenTargetError{Target: target.String(), Reason: "resolves to a denied IP range"}
+	}
+
+	return nil
+}
+
+func schemeAllowed(allowed []string, scheme string) bool {
+	for _, s := range allowed {
+		if strings.EqualFold(s, scheme) {
+			return true
+		}
+	}
+	return false
+}
+
+func hostMatchesAny(patterns []string, host string) bool {
+	for _, p := range patterns {
+		if hostMatches(p, host) {
+			return true
+		}
+	}
+	return false
+}
+
+func hostMatches(pattern, host string) bool {
+	if _, cidr, err := net.ParseCIDR(pattern); err == nil {
+		if ip := net.ParseIP(host); ip != nil {
+			return cidr.Contains(ip)
+		}
+		return false
+	}
+	matched, err := path.Match(strings.ToLower(pattern), strings.ToLower(host))
+	return err == nil && matched
+}
+
+// metadataAddrs are cloud instance-metadata endpoints that are not covered
+// by the generic private-range checks below but must always be denied.
+var metadataAddrs = []string{"169.254.169.254", "fd00:ec2::254"}
+
+// isDeniedIP reports whether ip falls in a range that must never be reached
+// by the proxy: loopback, RFC1918 private space, link-local (which also
+// covers the 169.254.169.254 cloud metadata address), unique local (ULA)
+// IPv6, IPv4-mapped IPv6 wrapping a denied IPv4 address, or an explicit
+// cloud metadata literal.
+func isDeniedIP(ip net.IP) bool {
+	for _, addr := range metadataAddrs {
+		if ip.Equal(net.ParseIP(addr)) {
+			return true
+		}
+	}
+
+	if mapped := ip.To4(); mapped != nil && len(ip) == net.IPv6len {
+		// ip was a 16-byte form of a v4 address (IPv4-mapped IPv6).
+		return isDeniedIP(mapped)
+	}
+
+	if ip.IsLoopback() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsUnspecified() {
+		return true
+	}
+
+	if ip4 := ip.To4(); ip4 != nil {
+		for _, cidr := range []string{"10.0.0.0/8", "172.16.0.0/12", "192.168.0.0/16", "100.64.0.0/10"} {
+			_, block, _ := net.ParseCIDR(cidr)
+			if block.Contains(ip4) {
+				return true
+			}
+		}
+		return false
+	}
+
+	// IPv6 unique local addresses (ULA), fc00::/7.
+	if ip[0]&0xfe == 0xfc {
+		return true
+	}
+
+	return false
+}
+
+// safeDialContext returns a DialContext that re-resolves host on every dial
+// and rejects the connection if any resolved IP is denied, closing the
+// DNS-rebinding gap where a hostname's A/AAAA record passes the initial
+// check but changes by the time the transport dials it.
+func safeDialContext(sec SecurityConfig) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	dialer := &net.Dialer{}
+
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		host, port, err := net.SplitHostPort(addr)
+		if err != nil {
+			return nil, err
+		}
+
+		ips, err := net.DefaultResolver.LookupIP(ctx, "ip", host)
+		if err != nil {
+			return nil, err
+		}
+		if len(ips) == 0 {
+			return nil, &ForbiddenTargetError{Target: addr, Reason: "host did not resolve"}
+		}
+
+		if len(sec.AllowedHosts) > 0 && hostMatchesAny(sec.AllowedHosts, host) {
+			return dialer.DialContext(ctx, network, addr)
+		}
+
+		for _, ip := range ips {
+			if isDeniedIP(ip) {
+				return nil, &ForbiddenTargetError{Target: addr, Reason: "resolved to a denied IP range"}
+			}
+		}
+
+		return dialer.DialContext(ctx, network, net.JoinHostPort(ips[0].String(), port))
+	}
+}
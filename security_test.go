@@ -0,0 +1,76 @@
+package main
+
+import (
+	"net"
+	"net/url"
+	"testing"
+)
+
+func TestIsDeniedIP(t *testing.T) {
+	denied := []string{
+		"127.0.0.1",
+		"10.0.0.5",
+		"172.16.0.5",
+		"192.168.1.1",
+		"169.254.169.254",
+		"fd00:ec2::254",
+		"fe80::1",
+		"fc00::1",
+		"::ffff:169.254.169.254",
+	}
+	for _, addr := range denied {
+		if ip := net.ParseIP(addr); !isDeniedIP(ip) {
+			t.Errorf("expected %s to be denied", addr)
+		}
+	}
+
+	allowed := []string{"8.8.8.8", "1.1.1.1", "93.184.216.34"}
+	for _, addr := range allowed {
+		if ip := net.ParseIP(addr); isDeniedIP(ip) {
+			t.Errorf("expected %s to be allowed", addr)
+		}
+	}
+}
+
+func TestCheckURLPolicy(t *testing.T) {
+	sec := DefaultConfig().Security
+
+	t.Run("denies metadata IP", func(t *testing.T) {
+		target, _ := url.Parse("http://169.254.169.254/latest/meta-data")
+		if err := checkURLPolicy(sec, target); err == nil {
+			t.Error("expected metadata target to be rejected")
+		}
+	})
+
+	t.Run("denies disallowed scheme", func(t *testing.T) {
+		target, _ := url.Parse("ftp://example.com/file")
+		if err := checkURLPolicy(sec, target); err == nil {
+			t.Error("expected ftp scheme to be rejected")
+		}
+	})
+
+	t.Run("allows ordinary public target", func(t *testing.T) {
+		target, _ := url.Parse("https://example.com/path")
+		if err := checkURLPolicy(sec, target); err != nil {
+			t.Errorf("expected public target to be allowed, got %v", err)
+		}
+	})
+
+	t.Run("enforces denylist globs", func(t *testing.T) {
+		sec := sec
+		sec.DeniedHosts = []string{"*.internal.example.com"}
+		target, _ := url.Parse("https://svc.internal.example.com/")
+		if err := checkURLPolicy(sec, target); err == nil {
+			t.Error("expected denylisted host to be rejected")
+		}
+	})
+
+	t.Run("enforces allowlist", func(t *testing.T) {
+		sec := sec
+		sec.AllowedHosts = []string{"api.example.com"}
+		target, _ := url.Parse("https://other.example.com/")
+		if err := checkURLPolicy(sec, target); err == nil {
+			t.Error("expected host outside allowlist to be rejected")
+		}
+	})
+}
@@ -3,26 +3,20 @@ package main
 import (
 	"context"
 	"fmt"
-	"io"
 	"log"
 	"net/http"
 	"net/url"
 	"os"
 	"os/signal"
-	"strings"
 	"syscall"
 	"time"
 )
 
-func proxyHandler(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Access-Control-Allow-Origin", "*")
-	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
-	w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
-
-	if r.Method == "OPTIONS" {
-		return
-	}
+// appConfig is loaded once in main from GHISA_CONFIG and consulted by
+// proxyHandler on every request.
+var appConfig = DefaultConfig()
 
+func proxyHandler(w http.ResponseWriter, r *http.Request) {
 	targetURL := r.URL.Query().Get("url")
 	if targetURL == "" {
 		http.Error(w, "Missing url parameter", http.StatusBadRequest)
@@ -35,49 +29,46 @@ func proxyHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	var req *http.Request
-	if r.Method == http.MethodPost {
-		body, err := io.ReadAll(r.Body)
-		if err != nil {
-			http.Error(w, "GHISA: Failed to read request body", http.StatusInternalServerError)
-			return
-		}
-		req, err = http.NewRequest(http.MethodPost, proxyURL.String(), strings.NewReader(string(body)))
-		if err != nil {
-			http.Error(w, "GHISA: Failed to create request", http.StatusInternalServerError)
-			return
-		}
-		req.Header = r.Header
-	} else {
-		req, err = http.NewRequest(http.MethodGet, proxyURL.String(), nil)
-		if err != nil {
-			http.Error(w, "GHISA: Failed to create request", http.StatusInternalServerError)
-			return
-		}
-		req.Header = r.Header
+	if forbidden := checkURLPolicy(appConfig.Security, proxyURL); forbidden != nil {
+		writeForbiddenTarget(w, forbidden)
+		return
 	}
 
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		http.Error(w, "GHISA: Failed to make request", http.StatusInternalServerError)
+	if isWebSocketUpgrade(r) {
+		serveWebSocket(w, r, proxyURL, appConfig.Security)
 		return
 	}
-	defer resp.Body.Close()
 
-	for key, values := range resp.Header {
-		for _, value := range values {
-			w.Header().Add(key, value)
-		}
+	breaker := appBreakers.get(proxyURL.Hostname())
+
+	ctx, cancel := context.WithTimeout(r.Context(), appConfig.Security.RequestTimeout.Duration)
+	defer cancel()
+	r = r.WithContext(ctx)
+
+	if r.Body != nil && appConfig.Security.MaxRequestBodyBytes > 0 {
+		r.Body = http.MaxBytesReader(w, r.Body, appConfig.Security.MaxRequestBodyBytes)
 	}
 
-	w.WriteHeader(resp.StatusCode)
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		http.Error(w, "GHISA: Failed to read response body", http.StatusInternalServerError)
+	if r.Method == http.MethodGet && r.URL.Query().Get("nocache") != "1" {
+		// serveCached decides for itself whether this request actually needs
+		// to reach upstream (a MISS, or a stale-while-revalidate refresh) and
+		// gates that with breaker.allow(); a cache HIT never touches the
+		// upstream and must not consume a half-open probe or count as a
+		// success.
+		serveCached(w, r, proxyURL, appConfig.Security, breaker)
+		return
+	}
+
+	if !breaker.allow() {
+		writeBreakerOpen(w, proxyURL.Hostname())
 		return
 	}
-	w.Write(body)
+
+	rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+	defer func() { breaker.recordResult(rec.status < http.StatusInternalServerError) }()
+
+	rec.Header().Set("X-Ghisa-Cache", "BYPASS")
+	newReverseProxy(proxyURL, appConfig.Security).ServeHTTP(rec, r)
 }
 
 func healthHandler(w http.ResponseWriter, req *http.Request) {
@@ -96,13 +87,24 @@ func healthHandler(w http.ResponseWriter, req *http.Request) {
 }
 
 func main() {
+	cfg, err := LoadConfig(os.Getenv("GHISA_CONFIG"))
+	if err != nil {
+		log.Fatalf("GHISA: %v\n", err)
+	}
+	appConfig = cfg
+	appRateLimiter = newRateLimiterRegistry(cfg.RateLimit)
+	appBreakers = newBreakerRegistry(cfg.Breaker)
+
 	mux := http.NewServeMux()
 	mux.HandleFunc("/", proxyHandler)
 	mux.HandleFunc("/health", healthHandler)
+	mux.HandleFunc("/metrics", metricsHandler)
+
+	handler := corsMiddleware(RecoveryMiddleware(LoggingMiddleware(MetricsMiddleware(RateLimitMiddleware(mux, appRateLimiter)))), appConfig.Cors)
 
 	server := &http.Server{
 		Addr:              ":5552",
-		Handler:           mux,
+		Handler:           handler,
 		ReadHeaderTimeout: 5 * time.Second,
 	}
 
@@ -0,0 +1,49 @@
+package main
+
+import "sync"
+
+// sfCall represents an in-flight or completed fetchGroup.Do call for a
+// single cache key.
+type sfCall struct {
+	wg  sync.WaitGroup
+	val interface{}
+	err error
+}
+
+// singleflightGroup coalesces concurrent calls sharing the same key into a
+// single execution of fn, so concurrent identical proxied requests trigger
+// only one upstream fetch. It mirrors the shape of golang.org/x/sync's
+// singleflight.Group.
+type singleflightGroup struct {
+	mu    sync.Mutex
+	calls map[string]*sfCall
+}
+
+func newSingleflightGroup() *singleflightGroup {
+	return &singleflightGroup{calls: make(map[string]*sfCall)}
+}
+
+// Do executes fn for key, or waits for and returns the result of an
+// identical call already in flight. shared reports whether val/err came
+// from such a shared call rather than this caller's own invocation of fn.
+func (g *singleflightGroup) Do(key string, fn func() (interface{}, error)) (val interface{}, err error, shared bool) {
+	g.mu.Lock()
+	if call, ok := g.calls[key]; ok {
+		g.mu.Unlock()
+		call.wg.Wait()
+		return call.val, call.err, true
+	}
+	call := &sfCall{}
+	call.wg.Add(1)
+	g.calls[key] = call
+	g.mu.Unlock()
+
+	call.val, call.err = fn()
+	call.wg.Done()
+
+	g.mu.Lock()
+	delete(g.calls, key)
+	g.mu.Unlock()
+
+	return call.val, call.err, false
+}